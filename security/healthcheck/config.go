@@ -0,0 +1,800 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	defaultURL      = "http://localhost:8080/health"
+	defaultTimeout  = "5s"
+	defaultWait     = 2 * time.Minute
+	defaultWorkers  = 4
+	defaultListen   = ":9000"
+	defaultInterval = 30 * time.Second
+	defaultMaxBody  = 1 << 20
+	maxRedirects    = 10
+)
+
+// Config is the resolved set of options for a single healthcheck run.
+type Config struct {
+	URLs              []string            `json:"urls"`
+	TCPAddr           string              `json:"tcp,omitempty"`
+	GRPCAddr          string              `json:"grpc,omitempty"`
+	Ping              string              `json:"ping,omitempty"`
+	GRPCService       string              `json:"grpc_service,omitempty"`
+	GRPCTLS           bool                `json:"grpc_tls"`
+	UnixSocket        string              `json:"unix,omitempty"`
+	LocalAddr         *net.TCPAddr        `json:"local_addr,omitempty"`
+	Resolve           map[string]string   `json:"resolve,omitempty"`
+	Proxy             string              `json:"proxy,omitempty"`
+	Host              string              `json:"host,omitempty"`
+	NoProxy           bool                `json:"no_proxy"`
+	SOCKS5            string              `json:"socks5,omitempty"`
+	SOCKS5User        string              `json:"socks5_user,omitempty"`
+	SOCKS5Password    string              `json:"socks5_password,omitempty"`
+	Method            string              `json:"method"`
+	Body              string              `json:"body,omitempty"`
+	Timeout           time.Duration       `json:"timeout"`
+	MaxLatency        time.Duration       `json:"max_latency"`
+	Retries           int                 `json:"retries"`
+	RetryInterval     time.Duration       `json:"retry_interval"`
+	Wait              bool                `json:"wait"`
+	WaitTimeout       time.Duration       `json:"wait_timeout"`
+	Deadline          time.Duration       `json:"deadline"`
+	GracePeriod       time.Duration       `json:"grace_period"`
+	StartFile         string              `json:"start_file,omitempty"`
+	Insecure          bool                `json:"insecure"`
+	CACert            string              `json:"ca_cert,omitempty"`
+	ClientCert        string              `json:"client_cert,omitempty"`
+	ClientKey         string              `json:"client_key,omitempty"`
+	TLSMinVersion     uint16              `json:"tls_min_version"`
+	TLSMaxVersion     uint16              `json:"tls_max_version,omitempty"`
+	HTTP1             bool                `json:"http1"`
+	NoKeepAlive       bool                `json:"no_keepalive"`
+	NoCompression     bool                `json:"no_compression"`
+	Redirects         bool                `json:"follow_redirects"`
+	MaxRedirects      int                 `json:"max_redirects"`
+	StatusCodes       map[int]bool        `json:"status"`
+	ReachableOnly     bool                `json:"reachable_only"`
+	ExpectBody        string              `json:"expect_body,omitempty"`
+	ExpectRegex       *regexp.Regexp      `json:"expect_regex,omitempty"`
+	ExpectHeaders     []headerExpectation `json:"expect_headers,omitempty"`
+	JSONPath          string              `json:"json_path,omitempty"`
+	JSONValue         *string             `json:"json_value,omitempty"`
+	MaxResponseBytes  int64               `json:"max_response_bytes"`
+	Headers           http.Header         `json:"headers"`
+	UserAgent         string              `json:"user_agent"`
+	User              string              `json:"user,omitempty"`
+	Password          string              `json:"password,omitempty"`
+	Workers           int                 `json:"workers"`
+	Any               bool                `json:"any"`
+	Format            string              `json:"format"`
+	MetricsFile       string              `json:"metrics_file,omitempty"`
+	Verbose           bool                `json:"verbose"`
+	DumpHeaders       bool                `json:"dump_headers"`
+	SaveBodyOnFail    string              `json:"save_body_on_fail,omitempty"`
+	Daemon            bool                `json:"daemon"`
+	Listen            string              `json:"listen,omitempty"`
+	Interval          time.Duration       `json:"interval"`
+	Jitter            time.Duration       `json:"jitter"`
+	IntervalImmediate bool                `json:"interval_immediate"`
+	PrintConfig       bool                `json:"-"`
+	Diagnose          bool                `json:"-"`
+	ShowVersion       bool                `json:"-"`
+}
+
+func loadConfig() (Config, error) {
+	var (
+		targets      stringList
+		headers      headerFlag
+		resolves     stringList
+		expectHdrs   stringList
+		expectHdrRes stringList
+	)
+	flag.Var(&targets, "url", "health endpoint URL, repeatable (env HEALTHCHECK_URL, default "+defaultURL+")")
+	flag.Var(&headers, "header", `request header as "Name: Value", repeatable; $VAR and ${VAR} in the value are read from the environment`)
+	flag.Var(&expectHdrs, "expect-header", `response header that must be present as "Name", or have a value as "Name: value", repeatable`)
+	flag.Var(&expectHdrRes, "expect-header-regex", `response header whose value must match a regular expression, as "Name: regex", repeatable`)
+	flag.Var(&resolves, "resolve", "connect to ip instead of resolving host:port, as host:port:ip, repeatable")
+	var (
+		tcpAddr       = flag.String("tcp", "", "check that host:port accepts TCP connections instead of making an HTTP request")
+		grpcAddr      = flag.String("grpc", "", "call grpc.health.v1.Health/Check on host:port instead of making an HTTP request")
+		pingHost      = flag.String("ping", "", "send an ICMP echo request to host instead of making an HTTP request; needs CAP_NET_RAW")
+		grpcService   = flag.String("grpc-service", "", "service name sent in the gRPC health check request")
+		grpcTLS       = flag.Bool("grpc-tls", false, "use TLS for the gRPC connection (implied by -insecure, -ca-cert and -client-cert)")
+		localAddr     = flag.String("local-addr", "", "local IP address (optionally ip:port) to originate connections from")
+		proxyURL      = flag.String("proxy", "", "proxy URL for HTTP checks (http, https or socks5); defaults to HTTP_PROXY/HTTPS_PROXY/NO_PROXY")
+		noProxy       = flag.Bool("no-proxy", false, "connect directly even when HTTP_PROXY/HTTPS_PROXY are set")
+		hostOverride  = flag.String("host", "", "Host header and TLS server name to present instead of the ones from the target")
+		socks5        = flag.String("socks5", "", "connect through the SOCKS5 proxy at host:port")
+		socks5User    = flag.String("socks5-user", "", "user name for -socks5 authentication")
+		socks5Pass    = flag.String("socks5-password", "", "password for -socks5 authentication")
+		unixSocket    = flag.String("unix", "", "send the HTTP request over this Unix socket, e.g. with -url http://unix/health")
+		method        = flag.String("method", http.MethodGet, "HTTP request method")
+		body          = flag.String("body", "", "request body for POST, PUT and PATCH")
+		bodyFile      = flag.String("body-file", "", "file to read the request body from")
+		timeoutRaw    = flag.String("timeout", envOr("HEALTHCHECK_TIMEOUT", defaultTimeout), "request timeout, e.g. 10s or 500ms (env HEALTHCHECK_TIMEOUT)")
+		maxLatency    = flag.Duration("max-latency", 0, "report degraded when a successful check takes longer than this (0 disables)")
+		retries       = flag.Int("retries", 0, "additional attempts before reporting unhealthy")
+		retryInterval = flag.Duration("retry-interval", time.Second, "delay between attempts")
+		wait          = flag.Bool("wait", false, "keep checking every -retry-interval until healthy or -wait-timeout expires")
+		waitTimeout   = flag.Duration("wait-timeout", defaultWait, "overall deadline for -wait")
+		deadline      = flag.Duration("deadline", 0, "hard limit on the total run time across all retries and waits (0 disables)")
+		gracePeriod   = flag.Duration("grace-period", 0, "report failures as healthy with a warning until the container has run this long (0 disables)")
+		startFile     = flag.String("start-file", "", "file whose modification time marks the container start for -grace-period; defaults to the start of PID 1")
+		insecure      = flag.Bool("insecure", false, "skip TLS certificate verification")
+		caCert        = flag.String("ca-cert", "", "PEM file with CA certificates used to verify the server")
+		clientCert    = flag.String("client-cert", "", "PEM client certificate for mutual TLS, used with -client-key")
+		clientKey     = flag.String("client-key", "", "PEM private key for -client-cert")
+		tlsMinRaw     = flag.String("tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3")
+		tlsMaxRaw     = flag.String("tls-max-version", "", "maximum TLS version, e.g. to test negotiation; defaults to the newest supported")
+		noKeepAlive   = flag.Bool("no-keepalive", false, "open a fresh connection, with a full TLS handshake, for every HTTP check")
+		noCompression = flag.Bool("no-compression", false, "do not request gzip responses; bodies are matched as received")
+		http1         = flag.Bool("http1", false, "force HTTP/1.1; by default HTTP/2 is negotiated over TLS when the server offers it")
+		redirects     = flag.Bool("follow-redirects", true, "follow redirects; when false the 3xx response itself is matched against -status")
+		maxRedirs     = flag.Int("max-redirects", maxRedirects, "maximum number of redirects to follow")
+		statusRaw     = flag.String("status", "200", "comma-separated list of healthy status codes")
+		user          = flag.String("user", "", "basic auth user name")
+		password      = flag.String("password", "", "basic auth password (prefer -password-file or HEALTHCHECK_PASSWORD)")
+		passwordFile  = flag.String("password-file", "", "file containing the basic auth password")
+		maxBody       = flag.Int64("max-response-bytes", defaultMaxBody, "largest response body read for matching; bigger bodies fail the check")
+		reachable     = flag.Bool("reachable-only", false, "treat any HTTP response as healthy; only connection errors and timeouts fail")
+		expectBody    = flag.String("expect-body", "", "substring the response body must contain")
+		expectRegex   = flag.String("expect-regex", "", "regular expression the response body must match")
+		jsonPath      = flag.String("json-path", "", "dotted path to a field of the JSON response body, e.g. db.state")
+		jsonValue     = flag.String("json-value", "", "value the -json-path field must have; without it the field only has to exist")
+		jsonOutput    = flag.Bool("json", false, "shorthand for -format json")
+		format        = flag.String("format", "text", "output format: text (errors to stderr only), json or logfmt (results to stdout)")
+		metricsFile   = flag.String("metrics-file", "", "write Prometheus textfile collector metrics to this path")
+		verbose       = flag.Bool("v", false, "log each attempt and the final decision to stderr")
+		saveBody      = flag.String("save-body-on-fail", "", "write the response body of failed HTTP checks to this path, with a timestamp added to the file name")
+		dumpHdrs      = flag.Bool("dump-headers", false, "print the response status line and headers of failed HTTP checks to stderr; credentials are redacted unless -v")
+		workers       = flag.Int("workers", defaultWorkers, "maximum number of targets checked concurrently")
+		anyHealthy    = flag.Bool("any", false, "report healthy when at least one target passes instead of all")
+		daemon        = flag.Bool("daemon", false, "keep polling every -interval and serve the latest result on -listen /healthz")
+		listen        = flag.String("listen", defaultListen, "address the -daemon /healthz endpoint listens on")
+		interval      = flag.Duration("interval", defaultInterval, "delay between polls in -daemon mode")
+		jitter        = flag.Duration("jitter", 0, "move each -interval by a random amount within ±jitter so sidecars do not poll in step")
+		immediate     = flag.Bool("interval-immediate", true, "run the first -daemon check at startup instead of after one interval")
+		userAgent     = flag.String("user-agent", "openclaw-healthcheck/"+version, "User-Agent sent with HTTP and gRPC checks")
+		showVersion   = flag.Bool("version", false, "print the build version and exit")
+		diagnose      = flag.Bool("diagnose", false, "report DNS, TCP, TLS and HTTP for each URL step by step to stdout instead of a plain check")
+		printCfg      = flag.Bool("print-config", false, "print the effective configuration as JSON and exit without checking")
+		configPath    = flag.String("config", "", "YAML or JSON file with option values; command-line flags take precedence")
+		noExpand      = flag.Bool("no-expand", false, "take flag values literally instead of replacing ${VAR} with environment variables")
+		help          = flag.Bool("help", false, "print this help and exit")
+	)
+	flag.BoolVar(help, "h", false, "shorthand for -help")
+	flag.Usage = usage
+	if err := flag.CommandLine.Parse(splitShortFlags(flag.CommandLine, os.Args[1:])); err != nil {
+		return Config{}, err
+	}
+	if *help {
+		return Config{}, flag.ErrHelp
+	}
+	// Like -help, -version must work whatever else is set or misconfigured.
+	if *showVersion {
+		return Config{ShowVersion: true}, nil
+	}
+
+	if *configPath != "" {
+		if !*noExpand {
+			path, err := expandBraced(*configPath)
+			if err != nil {
+				return Config{}, fmt.Errorf("-config: %v (use -no-expand for literal values)", err)
+			}
+			*configPath = path
+		}
+		if err := applyConfigFile(*configPath); err != nil {
+			return Config{}, err
+		}
+	}
+	if !*noExpand {
+		if err := expandFlags(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	httpMode := *tcpAddr == "" && *grpcAddr == "" && *pingHost == ""
+	if countSet(isFlagSet("url"), *tcpAddr != "", *grpcAddr != "", *pingHost != "") > 1 {
+		return Config{}, fmt.Errorf("-url, -tcp, -grpc and -ping are mutually exclusive")
+	}
+	if *unixSocket != "" && !httpMode {
+		return Config{}, fmt.Errorf("-unix can only be used for HTTP checks")
+	}
+	if *dumpHdrs && !httpMode {
+		return Config{}, fmt.Errorf("-dump-headers can only be used for HTTP checks")
+	}
+	if *reachable {
+		if !httpMode {
+			return Config{}, fmt.Errorf("-reachable-only can only be used for HTTP checks")
+		}
+		if isFlagSet("status") || *expectBody != "" || *expectRegex != "" || *jsonPath != "" || len(expectHdrs)+len(expectHdrRes) > 0 {
+			return Config{}, fmt.Errorf("-reachable-only cannot be combined with -status, -expect-body, -expect-regex, -json-path, -expect-header or -expect-header-regex")
+		}
+	}
+	if *saveBody != "" && !httpMode {
+		return Config{}, fmt.Errorf("-save-body-on-fail can only be used for HTTP checks")
+	}
+	if *noKeepAlive && !httpMode {
+		return Config{}, fmt.Errorf("-no-keepalive can only be used for HTTP checks")
+	}
+	if *noCompression && !httpMode {
+		return Config{}, fmt.Errorf("-no-compression can only be used for HTTP checks")
+	}
+	for name, addr := range map[string]string{"tcp": *tcpAddr, "grpc": *grpcAddr} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return Config{}, fmt.Errorf("invalid %s address: %w", name, err)
+		}
+	}
+	if (*proxyURL != "" || *noProxy) && !httpMode {
+		return Config{}, fmt.Errorf("-proxy and -no-proxy can only be used for HTTP checks")
+	}
+	if *proxyURL != "" {
+		if *noProxy {
+			return Config{}, fmt.Errorf("-proxy and -no-proxy are mutually exclusive")
+		}
+		if err := validateProxyURL(*proxyURL); err != nil {
+			return Config{}, err
+		}
+	}
+	if *hostOverride != "" && (*tcpAddr != "" || *pingHost != "") {
+		return Config{}, fmt.Errorf("-host can only be used for HTTP and gRPC checks")
+	}
+	if (*clientCert == "") != (*clientKey == "") {
+		return Config{}, fmt.Errorf("-client-cert and -client-key must be given together")
+	}
+	tlsMin, err := parseTLSVersion(*tlsMinRaw)
+	if err != nil {
+		return Config{}, err
+	}
+	var tlsMax uint16
+	if *tlsMaxRaw != "" {
+		if tlsMax, err = parseTLSVersion(*tlsMaxRaw); err != nil {
+			return Config{}, err
+		}
+		if tlsMax < tlsMin {
+			return Config{}, fmt.Errorf("-tls-max-version %s is lower than -tls-min-version %s", *tlsMaxRaw, *tlsMinRaw)
+		}
+	}
+	overrides, err := parseResolve(resolves)
+	if err != nil {
+		return Config{}, err
+	}
+	if *socks5 != "" {
+		if *unixSocket != "" || *proxyURL != "" || *pingHost != "" {
+			return Config{}, fmt.Errorf("-socks5 cannot be combined with -unix, -proxy or -ping")
+		}
+		if _, _, err := net.SplitHostPort(*socks5); err != nil {
+			return Config{}, fmt.Errorf("invalid socks5 address: %w", err)
+		}
+	}
+	if (*socks5User != "" || *socks5Pass != "") && *socks5 == "" {
+		return Config{}, fmt.Errorf("-socks5-user and -socks5-password require -socks5")
+	}
+	var sourceAddr *net.TCPAddr
+	if *localAddr != "" {
+		if *unixSocket != "" {
+			return Config{}, fmt.Errorf("-local-addr cannot be used with -unix")
+		}
+		var err error
+		if sourceAddr, err = parseLocalAddr(*localAddr); err != nil {
+			return Config{}, err
+		}
+	}
+	if len(targets) == 0 {
+		targets = stringList{envOr("HEALTHCHECK_URL", defaultURL)}
+	}
+	if httpMode {
+		for _, target := range targets {
+			if err := validateURL(target); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+	timeout, err := parseTimeout(*timeoutRaw)
+	if err != nil {
+		return Config{}, err
+	}
+	if *maxLatency < 0 {
+		return Config{}, fmt.Errorf("invalid max latency %s: must not be negative", *maxLatency)
+	}
+	if *retries < 0 {
+		return Config{}, fmt.Errorf("invalid retries %d: must not be negative", *retries)
+	}
+	if *retryInterval < 0 {
+		return Config{}, fmt.Errorf("invalid retry interval %s: must not be negative", *retryInterval)
+	}
+	if *waitTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid wait timeout %s: must be greater than zero", *waitTimeout)
+	}
+	if *workers < 1 {
+		return Config{}, fmt.Errorf("invalid workers %d: must be at least 1", *workers)
+	}
+	if *deadline < 0 {
+		return Config{}, fmt.Errorf("invalid deadline %s: must not be negative", *deadline)
+	}
+	if *gracePeriod < 0 {
+		return Config{}, fmt.Errorf("invalid grace period %s: must not be negative", *gracePeriod)
+	}
+	if _, ok := formats[*format]; !ok {
+		return Config{}, fmt.Errorf("invalid format %q: must be text, json or logfmt", *format)
+	}
+	if *jsonOutput {
+		if isFlagSet("format") && *format != "json" {
+			return Config{}, fmt.Errorf("-json conflicts with -format %s", *format)
+		}
+		*format = "json"
+	}
+	if *diagnose && (!httpMode || *daemon) {
+		return Config{}, fmt.Errorf("-diagnose can only be used for HTTP checks and not with -daemon")
+	}
+	if *daemon {
+		if *wait || *format != "text" || *gracePeriod > 0 || *deadline > 0 {
+			return Config{}, fmt.Errorf("-daemon cannot be combined with -wait, -json, -format, -grace-period or -deadline")
+		}
+		if *interval <= 0 {
+			return Config{}, fmt.Errorf("invalid interval %s: must be greater than zero", *interval)
+		}
+		if *jitter < 0 || *jitter >= *interval {
+			return Config{}, fmt.Errorf("invalid jitter %s: must be at least zero and less than -interval", *jitter)
+		}
+		if _, _, err := net.SplitHostPort(*listen); err != nil {
+			return Config{}, fmt.Errorf("invalid listen address: %w", err)
+		}
+	}
+	if *maxBody < 1 {
+		return Config{}, fmt.Errorf("invalid max response bytes %d: must be at least 1", *maxBody)
+	}
+	if *maxRedirs < 0 {
+		return Config{}, fmt.Errorf("invalid max redirects %d: must not be negative", *maxRedirs)
+	}
+	requestMethod := strings.ToUpper(*method)
+	if _, err := http.NewRequest(requestMethod, defaultURL, nil); err != nil {
+		return Config{}, fmt.Errorf("invalid method %q", *method)
+	}
+	requestBody, err := loadBody(*body, *bodyFile)
+	if err != nil {
+		return Config{}, err
+	}
+	if requestBody != "" && (requestMethod == http.MethodGet || requestMethod == http.MethodHead) {
+		return Config{}, fmt.Errorf("a request body cannot be sent with %s", requestMethod)
+	}
+	requestHeaders, err := headers.parse(!*noExpand)
+	if err != nil {
+		return Config{}, err
+	}
+	if *hostOverride != "" && requestHeaders.Get("Host") != "" {
+		return Config{}, fmt.Errorf("-host and a Host header are mutually exclusive")
+	}
+	var secret string
+	if *user != "" {
+		if requestHeaders.Get("Authorization") != "" {
+			return Config{}, fmt.Errorf("-user and an Authorization -header are mutually exclusive")
+		}
+		if secret, err = resolvePassword(*password, *passwordFile); err != nil {
+			return Config{}, err
+		}
+	} else if *password != "" || *passwordFile != "" {
+		return Config{}, fmt.Errorf("-password and -password-file require -user")
+	}
+	statusCodes, err := parseStatusCodes(*statusRaw)
+	if err != nil {
+		return Config{}, err
+	}
+	var fieldValue *string
+	if isFlagSet("json-value") {
+		if *jsonPath == "" {
+			return Config{}, fmt.Errorf("-json-value requires -json-path")
+		}
+		fieldValue = jsonValue
+	}
+	if *jsonPath != "" && slices.Contains(strings.Split(*jsonPath, "."), "") {
+		return Config{}, fmt.Errorf("invalid json path %q", *jsonPath)
+	}
+	headerChecks, err := parseExpectHeaders(expectHdrs, expectHdrRes)
+	if err != nil {
+		return Config{}, err
+	}
+	var bodyRegex *regexp.Regexp
+	if *expectRegex != "" {
+		bodyRegex, err = regexp.Compile(*expectRegex)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid expect regex: %w", err)
+		}
+	}
+
+	return Config{
+		URLs:              targets,
+		TCPAddr:           *tcpAddr,
+		GRPCAddr:          *grpcAddr,
+		Ping:              *pingHost,
+		GRPCService:       *grpcService,
+		GRPCTLS:           *grpcTLS || *insecure || *caCert != "" || *clientCert != "",
+		UnixSocket:        *unixSocket,
+		LocalAddr:         sourceAddr,
+		Resolve:           overrides,
+		Proxy:             *proxyURL,
+		Host:              *hostOverride,
+		NoProxy:           *noProxy,
+		SOCKS5:            *socks5,
+		SOCKS5User:        *socks5User,
+		SOCKS5Password:    *socks5Pass,
+		Method:            requestMethod,
+		Body:              requestBody,
+		Timeout:           timeout,
+		MaxLatency:        *maxLatency,
+		Retries:           *retries,
+		RetryInterval:     *retryInterval,
+		Wait:              *wait,
+		WaitTimeout:       *waitTimeout,
+		Deadline:          *deadline,
+		GracePeriod:       *gracePeriod,
+		StartFile:         *startFile,
+		Insecure:          *insecure,
+		CACert:            *caCert,
+		ClientCert:        *clientCert,
+		ClientKey:         *clientKey,
+		TLSMinVersion:     tlsMin,
+		TLSMaxVersion:     tlsMax,
+		HTTP1:             *http1,
+		NoKeepAlive:       *noKeepAlive,
+		NoCompression:     *noCompression,
+		Redirects:         *redirects,
+		MaxRedirects:      *maxRedirs,
+		StatusCodes:       statusCodes,
+		ReachableOnly:     *reachable,
+		ExpectBody:        *expectBody,
+		ExpectRegex:       bodyRegex,
+		ExpectHeaders:     headerChecks,
+		JSONPath:          *jsonPath,
+		JSONValue:         fieldValue,
+		MaxResponseBytes:  *maxBody,
+		Headers:           requestHeaders,
+		UserAgent:         *userAgent,
+		User:              *user,
+		Password:          secret,
+		Format:            *format,
+		Workers:           *workers,
+		Any:               *anyHealthy,
+		MetricsFile:       *metricsFile,
+		Verbose:           *verbose,
+		DumpHeaders:       *dumpHdrs,
+		SaveBodyOnFail:    *saveBody,
+		Daemon:            *daemon,
+		Listen:            *listen,
+		Interval:          *interval,
+		Jitter:            *jitter,
+		IntervalImmediate: *immediate,
+		PrintConfig:       *printCfg,
+		Diagnose:          *diagnose,
+		ShowVersion:       *showVersion,
+	}, nil
+}
+
+// splitShortFlags unbundles single-letter boolean flags the POSIX way, so
+// -vh is read as -v -h. An argument is only split when it is not a flag
+// itself and every letter is such a flag; values of other flags and
+// everything from the first non-flag argument on are left alone.
+func splitShortFlags(fs *flag.FlagSet, args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			return append(out, args[i:]...)
+		}
+		name := strings.TrimPrefix(arg, "-")
+		if f := fs.Lookup(strings.TrimPrefix(name, "-")); f != nil || strings.ContainsRune(name, '=') {
+			out = append(out, arg)
+			if f != nil && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				out = append(out, args[i])
+			}
+			continue
+		}
+		bundle := make([]string, 0, len(name))
+		for _, letter := range name {
+			f := fs.Lookup(string(letter))
+			if f == nil || !isBoolFlag(f) {
+				bundle = nil
+				break
+			}
+			bundle = append(bundle, "-"+string(letter))
+		}
+		if len(bundle) < 2 {
+			bundle = []string{arg}
+		}
+		out = append(out, bundle...)
+	}
+	return out
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func (c Config) targets() []string {
+	switch {
+	case c.TCPAddr != "":
+		return []string{"tcp://" + c.TCPAddr}
+	case c.GRPCAddr != "":
+		return []string{"grpc://" + c.GRPCAddr}
+	case c.Ping != "":
+		return []string{"icmp://" + c.Ping}
+	default:
+		return c.URLs
+	}
+}
+
+// resolvePassword picks the basic auth password from -password, then
+// -password-file, then HEALTHCHECK_PASSWORD. Only an interactive terminal is
+// prompted; in a container the password must come from the file or env.
+func resolvePassword(password, passwordFile string) (string, error) {
+	switch {
+	case password != "":
+		return password, nil
+	case passwordFile != "":
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case os.Getenv("HEALTHCHECK_PASSWORD") != "":
+		return os.Getenv("HEALTHCHECK_PASSWORD"), nil
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Fprint(os.Stderr, "Password: ")
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return string(secret), nil
+	default:
+		return "", fmt.Errorf("-user requires -password-file or HEALTHCHECK_PASSWORD when stdin is not a terminal")
+	}
+}
+
+func loadBody(body, bodyFile string) (string, error) {
+	if bodyFile == "" {
+		return body, nil
+	}
+	if body != "" {
+		return "", fmt.Errorf("-body and -body-file are mutually exclusive")
+	}
+	data, err := os.ReadFile(bodyFile)
+	if err != nil {
+		return "", fmt.Errorf("read body file: %w", err)
+	}
+	return string(data), nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid url %q: missing host", raw)
+	}
+	return nil
+}
+
+func validateProxyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid proxy url %q: scheme must be http, https or socks5", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy url %q: missing host", u.Redacted())
+	}
+	return nil
+}
+
+// parseResolve turns curl-style host:port:ip mappings into a map from the
+// lower-cased host:port being dialled to the ip:port to connect to instead.
+func parseResolve(mappings []string) (map[string]string, error) {
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	overrides := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid resolve %q: expected host:port:ip", mapping)
+		}
+		host, port, ip := parts[0], parts[1], parts[2]
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid resolve %q: bad port %q", mapping, port)
+		}
+		ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid resolve %q: %q is not an IP address", mapping, ip)
+		}
+		addr := net.JoinHostPort(strings.ToLower(host), port)
+		if _, ok := overrides[addr]; ok {
+			return nil, fmt.Errorf("invalid resolve %q: %s is mapped more than once", mapping, addr)
+		}
+		overrides[addr] = net.JoinHostPort(ip, port)
+	}
+	return overrides, nil
+}
+
+// parseLocalAddr resolves a source address and makes sure it can be bound on
+// this host, so a typo fails at startup instead of as a connection error.
+func parseLocalAddr(raw string) (*net.TCPAddr, error) {
+	hostPort := raw
+	if _, _, err := net.SplitHostPort(raw); err != nil {
+		hostPort = net.JoinHostPort(raw, "0")
+	}
+	addr, err := net.ResolveTCPAddr("tcp", hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local address: %w", err)
+	}
+	probe, err := net.ListenTCP("tcp", &net.TCPAddr{IP: addr.IP, Zone: addr.Zone})
+	if err != nil {
+		return nil, fmt.Errorf("invalid local address %s: %w", raw, err)
+	}
+	probe.Close()
+	return addr, nil
+}
+
+func parseTimeout(raw string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %w", err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must be greater than zero", raw)
+	}
+	return timeout, nil
+}
+
+func parseStatusCodes(raw string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q in %q", part, raw)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// headerFlag collects repeated -header values.
+type headerFlag []string
+
+func (h *headerFlag) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlag) Set(value string) error {
+	if _, _, err := parseHeader(value); err != nil {
+		return err
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+func (h headerFlag) parse(expand bool) (http.Header, error) {
+	headers := make(http.Header)
+	for _, raw := range h {
+		name, value, err := parseHeader(raw)
+		if err != nil {
+			return nil, err
+		}
+		if expand {
+			if value, err = expandHeader(value); err != nil {
+				return nil, fmt.Errorf("-header %s: %w (use -no-expand for literal values)", name, err)
+			}
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// headerExpectation is a response header that must be present and, when
+// Value or Regex is set, have a matching value.
+type headerExpectation struct {
+	Name  string         `json:"name"`
+	Value string         `json:"value,omitempty"`
+	Regex *regexp.Regexp `json:"regex,omitempty"`
+}
+
+func parseExpectHeaders(exact, patterns []string) ([]headerExpectation, error) {
+	var checks []headerExpectation
+	for _, raw := range exact {
+		name, value, _ := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid expect header %q: expected \"Name\" or \"Name: value\"", raw)
+		}
+		checks = append(checks, headerExpectation{Name: http.CanonicalHeaderKey(name), Value: strings.TrimSpace(value)})
+	}
+	for _, raw := range patterns {
+		name, pattern, ok := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid expect header regex %q: expected \"Name: regex\"", raw)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect header regex for %s: %w", name, err)
+		}
+		checks = append(checks, headerExpectation{Name: http.CanonicalHeaderKey(name), Regex: re})
+	}
+	return checks, nil
+}
+
+func parseHeader(raw string) (string, string, error) {
+	name, value, ok := strings.Cut(raw, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid header %q: expected \"Name: Value\"", raw)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+func countSet(values ...bool) int {
+	count := 0
+	for _, set := range values {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envFlags maps flags to the environment variables that can also set them.
+// An environment variable takes precedence over the config file.
+var envFlags = map[string]string{
+	"url":     "HEALTHCHECK_URL",
+	"timeout": "HEALTHCHECK_TIMEOUT",
+}
+
+// applyConfigFile reads option values from a YAML or JSON file whose keys are
+// flag names, e.g.
+//
+//	url: [http://localhost:8080/health, http://localhost:8081/ready]
+//	timeout: 10s
+//	status: [200, 204]
+//	header:
+//	  Authorization: Bearer $TOKEN
+//	retries: 3
+//
+// Values are applied with flag.Set so they go through the same parsing and
+// validation as command-line flags. Flags given on the command line, and
+// their environment variables, win over the file.
+func applyConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, env := range envFlags {
+		if os.Getenv(env) != "" {
+			explicit[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("config %s: unknown option %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		items, err := configValues(f, values[name])
+		if err != nil {
+			return fmt.Errorf("config %s: %s: %w", path, name, err)
+		}
+		for _, item := range items {
+			if err := flag.Set(name, item); err != nil {
+				return fmt.Errorf("config %s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues converts a decoded config value into the strings passed to
+// flag.Set. Lists set repeatable flags once per item and are joined with
+// commas for list-valued flags such as -status; maps become "Name: Value"
+// pairs for -header.
+func configValues(f *flag.Flag, value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		if isRepeatable(f) {
+			return items, nil
+		}
+		return []string{strings.Join(items, ",")}, nil
+	case map[string]any:
+		if !isRepeatable(f) {
+			return nil, fmt.Errorf("unexpected mapping")
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(v))
+		for _, key := range keys {
+			items = append(items, fmt.Sprintf("%s: %v", key, v[key]))
+		}
+		return items, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+func isRepeatable(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, *headerFlag:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestSplitShortFlags(t *testing.T) {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Bool("v", false, "")
+	fs.Bool("h", false, "")
+	fs.Bool("insecure", false, "")
+	fs.String("url", "", "")
+	fs.String("x", "", "")
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"-vh"}, want: []string{"-v", "-h"}},
+		{args: []string{"-hv", "-insecure"}, want: []string{"-h", "-v", "-insecure"}},
+		{args: []string{"-v", "-h"}, want: []string{"-v", "-h"}},
+		{args: []string{"--vh"}, want: []string{"--vh"}},
+		{args: []string{"-url", "-vh"}, want: []string{"-url", "-vh"}},
+		{args: []string{"-url=-vh", "-vh"}, want: []string{"-url=-vh", "-v", "-h"}},
+		{args: []string{"-vx"}, want: []string{"-vx"}},
+		{args: []string{"-vq"}, want: []string{"-vq"}},
+		{args: []string{"--", "-vh"}, want: []string{"--", "-vh"}},
+		{args: []string{"extra", "-vh"}, want: []string{"extra", "-vh"}},
+	}
+	for _, tt := range tests {
+		if got := splitShortFlags(fs, tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("splitShortFlags(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// daemonState holds the results of the most recent poll for the /healthz
+// handler.
+type daemonState struct {
+	mu      sync.Mutex
+	results []result
+	err     error
+}
+
+func (s *daemonState) set(results []result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results, s.err = results, err
+}
+
+func (s *daemonState) get() ([]result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results, s.err
+}
+
+// ServeHTTP answers 200 when the latest poll was healthy and 503 otherwise,
+// including before the first poll has finished, with the per-target results
+// as JSON.
+func (s *daemonState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, err := s.get()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if results == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"error":"no check has completed yet"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := writeJSON(w, results); err != nil {
+		log.Printf("write /healthz response: %v", err)
+	}
+}
+
+// runDaemon polls the targets every cfg.Interval and serves the latest
+// result on cfg.Listen until ctx is cancelled.
+func runDaemon(ctx context.Context, cfg Config, probe probeFunc) int {
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return exitConfigError
+	}
+	state := &daemonState{}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", state)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	fmt.Fprintf(stderr, "healthcheck: serving /healthz on %s, checking every %s\n", listener.Addr(), cfg.Interval)
+
+	// Seeded per process so sidecars started together drift apart.
+	rng := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	var last error
+poll:
+	for round := 0; ; round++ {
+		if round > 0 || !cfg.IntervalImmediate {
+			timer := time.NewTimer(nextInterval(cfg, rng))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				break poll
+			case err := <-serveErr:
+				timer.Stop()
+				fmt.Fprintln(stderr, "healthcheck:", err)
+				return exitConfigError
+			case <-timer.C:
+			}
+		}
+		first := round == 0
+		results := checkAll(ctx, cfg, probe)
+		if ctx.Err() != nil {
+			break
+		}
+		err := overall(cfg, results)
+		state.set(results, err)
+		if cfg.MetricsFile != "" {
+			if err := writeMetrics(cfg.MetricsFile, results); err != nil {
+				warn(err.Error())
+			}
+		}
+		// Only log transitions so a steady state does not flood the logs.
+		switch {
+		case err == nil && (first || last != nil):
+			fmt.Fprintln(stderr, "healthcheck: healthy")
+		case err != nil && (first || last == nil):
+			printFailures(cfg, results)
+			if cfg.SaveBodyOnFail != "" {
+				saveFailedBodies(cfg.SaveBodyOnFail, results)
+			}
+		}
+		last = err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		warn(err.Error())
+	}
+	return exitHealthy
+}
+
+// nextInterval returns cfg.Interval moved by a random amount within
+// ±cfg.Jitter.
+func nextInterval(cfg Config, rng *rand.Rand) time.Duration {
+	if cfg.Jitter <= 0 {
+		return cfg.Interval
+	}
+	return cfg.Interval - cfg.Jitter + time.Duration(rng.Int63n(int64(2*cfg.Jitter)+1))
+}
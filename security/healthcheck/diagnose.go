@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// diagnosis prints the outcome of each -diagnose step and remembers
+// whether one failed.
+type diagnosis struct {
+	w      io.Writer
+	failed bool
+}
+
+func (d *diagnosis) step(name string, start time.Time, err error, format string, args ...any) {
+	elapsed := time.Since(start).Round(10 * time.Microsecond)
+	if err != nil {
+		fmt.Fprintf(d.w, "  %-5s FAIL  %v (%s)\n", name, err, elapsed)
+		d.failed = true
+		return
+	}
+	fmt.Fprintf(d.w, "  %-5s ok    %s (%s)\n", name, fmt.Sprintf(format, args...), elapsed)
+}
+
+func (d *diagnosis) skip(name, reason string) {
+	fmt.Fprintf(d.w, "  %-5s skip  %s\n", name, reason)
+}
+
+// runDiagnose checks each target step by step, DNS, TCP, TLS and then the
+// HTTP request itself, and prints every step it could run to w instead of
+// stopping at the first failure. The exit code classifies the first failed
+// HTTP request like a normal check, or is exitConnection when only an
+// earlier step failed.
+func runDiagnose(ctx context.Context, cfg Config, probe probeFunc, w io.Writer) int {
+	d := &diagnosis{w: w}
+	var httpErr error
+	for _, target := range cfg.targets() {
+		fmt.Fprintf(w, "%s\n", redactURL(target))
+		proxy := proxyFor(cfg, target)
+		diagnoseConnection(ctx, cfg, target, proxy, d)
+
+		res := result{Target: target, Attempt: 1}
+		start := time.Now()
+		err := probe(ctx, &res)
+		if err == nil {
+			err = checkLatency(cfg, res)
+		}
+		via := ""
+		switch {
+		case cfg.SOCKS5 != "":
+			via = " via socks5 " + cfg.SOCKS5
+		case proxy != nil:
+			via = " via proxy " + hostPort(proxy)
+		}
+		d.step("http", start, err, "%s %s%s", cfg.Method, res.Status, via)
+		if httpErr == nil {
+			httpErr = err
+		}
+	}
+	switch {
+	case cfg.Deadline > 0 && ctx.Err() == context.DeadlineExceeded:
+		return exitDeadline
+	case httpErr != nil:
+		return exitCode(httpErr)
+	case d.failed:
+		return exitConnection
+	default:
+		return exitHealthy
+	}
+}
+
+// proxyFor returns the HTTP proxy, from -proxy or the environment, that the
+// check of target goes through, or nil when it connects directly.
+func proxyFor(cfg Config, target string) *url.URL {
+	u, err := url.Parse(target)
+	if err != nil || cfg.NoProxy || cfg.SOCKS5 != "" || cfg.UnixSocket != "" {
+		return nil
+	}
+	if cfg.Proxy != "" {
+		proxy, _ := url.Parse(cfg.Proxy)
+		return proxy
+	}
+	proxy, _ := http.ProxyFromEnvironment(&http.Request{URL: u})
+	return proxy
+}
+
+// diagnoseConnection runs the DNS, TCP and TLS steps for an HTTP target.
+// Through an HTTP proxy only the connection to the proxy is checked, since
+// the proxy resolves and connects to the target itself.
+func diagnoseConnection(ctx context.Context, cfg Config, target string, proxy *url.URL, d *diagnosis) {
+	if cfg.UnixSocket != "" {
+		start := time.Now()
+		conn, err := newDialer(cfg).DialContext(ctx, "unix", cfg.UnixSocket)
+		if err == nil {
+			conn.Close()
+		}
+		d.step("unix", start, err, "connected to %s", cfg.UnixSocket)
+		return
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		d.step("dns", time.Now(), err, "")
+		return
+	}
+	addr := hostPort(u)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if proxy != nil {
+		diagnoseProxy(ctx, cfg, u, proxy, d)
+		return
+	}
+	start := time.Now()
+	switch override, ok := cfg.Resolve[strings.ToLower(addr)]; {
+	case ok:
+		d.step("dns", start, nil, "%s pinned to %s by -resolve", u.Hostname(), override)
+	case net.ParseIP(u.Hostname()) != nil:
+		d.skip("dns", u.Hostname()+" is an IP address")
+	case cfg.SOCKS5 != "":
+		d.skip("dns", "names are resolved by the socks5 proxy")
+	default:
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		names := make([]string, len(ips))
+		for i, ip := range ips {
+			names[i] = ip.String()
+		}
+		d.step("dns", start, err, "%s -> %s", u.Hostname(), strings.Join(names, ", "))
+		if err != nil {
+			d.skip("tcp", "no address to connect to")
+			if u.Scheme == "https" {
+				d.skip("tls", "no connection")
+			}
+			return
+		}
+	}
+
+	dial, err := newDialFunc(cfg)
+	if err != nil {
+		d.step("tcp", time.Now(), err, "")
+		return
+	}
+	start = time.Now()
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		d.step("tcp", start, err, "")
+		if u.Scheme == "https" {
+			d.skip("tls", "no connection")
+		}
+		return
+	}
+	defer conn.Close()
+	d.step("tcp", start, nil, "connected to %s from %s", conn.RemoteAddr(), conn.LocalAddr())
+	if u.Scheme != "https" {
+		return
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		d.step("tls", time.Now(), err, "")
+		return
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	if cfg.HTTP1 {
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	start = time.Now()
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		d.step("tls", start, err, "")
+		return
+	}
+	state := tlsConn.ConnectionState()
+	details := fmt.Sprintf("%s, %s, alpn %q", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.NegotiatedProtocol)
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		if subject := cert.Subject.String(); subject != "" {
+			details += fmt.Sprintf(", subject %q", subject)
+		}
+		if len(cert.DNSNames) > 0 {
+			details += ", names " + strings.Join(cert.DNSNames, " ")
+		}
+		if issuer := cert.Issuer.String(); issuer != "" {
+			details += fmt.Sprintf(", issuer %q", issuer)
+		}
+		details += fmt.Sprintf(", expires %s (in %d days)", cert.NotAfter.Format(time.DateOnly), int(time.Until(cert.NotAfter).Hours()/24))
+	}
+	if cfg.Insecure {
+		details += ", not verified (-insecure)"
+	}
+	d.step("tls", start, nil, "%s", details)
+}
+
+// diagnoseProxy stands in for the DNS, TCP and TLS steps of a target that is
+// reached through an HTTP proxy.
+func diagnoseProxy(ctx context.Context, cfg Config, u, proxy *url.URL, d *diagnosis) {
+	d.skip("dns", "resolved by the proxy")
+	addr := hostPort(proxy)
+	dial, err := newDialFunc(cfg)
+	if err != nil {
+		d.step("tcp", time.Now(), err, "")
+		return
+	}
+	start := time.Now()
+	conn, err := dial(ctx, "tcp", addr)
+	if err == nil {
+		conn.Close()
+	}
+	d.step("tcp", start, err, "connected to proxy %s", addr)
+	if u.Scheme == "https" {
+		d.skip("tls", "negotiated with the target through the proxy")
+	}
+}
+
+// defaultPorts are the ports net/http uses for targets and proxies that do
+// not name one.
+var defaultPorts = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}
+
+// hostPort returns the address a connection to u goes to.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// envRef matches the ${VAR} references expandFlags replaces. Bare $VAR is
+// left alone outside -header so values like regular expressions keep their
+// dollar signs.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandFlags replaces ${VAR} in the value of every string flag that was
+// set, on the command line or by the config file, with the environment
+// variable's value. -header values are expanded when they are parsed and
+// -config before the file is read.
+func expandFlags() error {
+	var errs []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		var err error
+		switch v := f.Value.(type) {
+		case *headerFlag:
+		case *stringList:
+			for i := range *v {
+				if (*v)[i], err = expandBraced((*v)[i]); err != nil {
+					break
+				}
+			}
+		default:
+			getter, ok := f.Value.(flag.Getter)
+			if !ok {
+				return
+			}
+			if _, isString := getter.Get().(string); !isString {
+				return
+			}
+			var value string
+			if value, err = expandBraced(f.Value.String()); err == nil && value != f.Value.String() {
+				err = f.Value.Set(value)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("-%s: %v", f.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s (use -no-expand for literal values)", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func expandBraced(s string) (string, error) {
+	var missing []string
+	out := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		value, ok := os.LookupEnv(ref[2 : len(ref)-1])
+		if !ok {
+			missing = append(missing, ref[2:len(ref)-1])
+		}
+		return value
+	})
+	return out, unresolved(missing)
+}
+
+// expandHeader replaces both $VAR and ${VAR} in a header value.
+func expandHeader(s string) (string, error) {
+	var missing []string
+	out := os.Expand(s, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	return out, unresolved(missing)
+}
+
+func unresolved(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return fmt.Errorf("environment variable %s not set", strings.Join(slices.Compact(names), ", "))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig runs loadConfig on args with a fresh flag set.
+func loadTestConfig(t *testing.T, args ...string) (Config, error) {
+	t.Helper()
+	savedFlags, savedArgs := flag.CommandLine, os.Args
+	t.Cleanup(func() { flag.CommandLine, os.Args = savedFlags, savedArgs })
+	flag.CommandLine = flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	os.Args = append([]string{"healthcheck"}, args...)
+	return loadConfig()
+}
+
+func TestExpandFlags(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hc.yaml"), []byte("expect-body: ${HC_WORD}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HC_HOST", "api.internal:8080")
+	t.Setenv("HC_WORD", "ready")
+	t.Setenv("HC_DIR", dir)
+
+	tests := []struct {
+		name    string
+		args    []string
+		check   func(Config) string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "set",
+			args:  []string{"-url", "http://${HC_HOST}/health"},
+			check: func(cfg Config) string { return cfg.URLs[0] },
+			want:  "http://api.internal:8080/health",
+		},
+		{
+			name:    "unset",
+			args:    []string{"-expect-body", "${HC_UNSET}"},
+			wantErr: "environment variable HC_UNSET not set",
+		},
+		{
+			name:  "no expand",
+			args:  []string{"-no-expand", "-expect-body", "${HC_WORD}", "-header", "X-Word: $HC_WORD"},
+			check: func(cfg Config) string { return cfg.ExpectBody + " " + cfg.Headers.Get("X-Word") },
+			want:  "${HC_WORD} $HC_WORD",
+		},
+		{
+			name:  "bare dollar",
+			args:  []string{"-expect-regex", `ok$`, "-expect-body", "$HC_WORD"},
+			check: func(cfg Config) string { return cfg.ExpectRegex.String() + " " + cfg.ExpectBody },
+			want:  "ok$ $HC_WORD",
+		},
+		{
+			name:  "header",
+			args:  []string{"-header", "X-Word: $HC_WORD ${HC_WORD}"},
+			check: func(cfg Config) string { return cfg.Headers.Get("X-Word") },
+			want:  "ready ready",
+		},
+		{
+			name:  "config path",
+			args:  []string{"-config", "${HC_DIR}/hc.yaml"},
+			check: func(cfg Config) string { return cfg.ExpectBody },
+			want:  "ready",
+		},
+		{
+			name:    "config path unset",
+			args:    []string{"-config", "${HC_UNSET}/hc.yaml"},
+			wantErr: "-config: environment variable HC_UNSET not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if got := tt.check(cfg); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/openclaw/openclaw/security/healthcheck
+
+go 1.22
+
+require (
+	golang.org/x/net v0.32.0
+	golang.org/x/term v0.27.0
+	google.golang.org/grpc v1.70.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+)
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the unit of process start times in /proc/<pid>/stat. The kernel
+// reports it as 100 on every architecture Linux containers run on.
+const userHZ = 100
+
+// startedAgo returns how long ago the container started: the modification
+// time of startFile when given, e.g. a pidfile written by the entrypoint,
+// otherwise the start time of PID 1, the container's main process.
+func startedAgo(startFile string) (time.Duration, error) {
+	if startFile != "" {
+		info, err := os.Stat(startFile)
+		if err != nil {
+			return 0, fmt.Errorf("read start time: %w", err)
+		}
+		return time.Since(info.ModTime()), nil
+	}
+	stat, err := os.ReadFile("/proc/1/stat")
+	if err != nil {
+		return 0, fmt.Errorf("read start time: %w", err)
+	}
+	// The command name in parentheses may contain spaces, so count fields
+	// from the closing parenthesis; starttime is field 22 overall.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("read start time: unexpected /proc/1/stat format")
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("read start time: %w", err)
+	}
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, fmt.Errorf("read start time: %w", err)
+	}
+	up, _, _ := strings.Cut(string(uptime), " ")
+	seconds, err := strconv.ParseFloat(up, 64)
+	if err != nil {
+		return 0, fmt.Errorf("read start time: %w", err)
+	}
+	started := time.Duration(ticks) * time.Second / userHZ
+	return time.Duration(seconds*float64(time.Second)) - started, nil
+}
+
+// inGracePeriod reports whether a failure should be forgiven because the
+// container started less than cfg.GracePeriod ago.
+func inGracePeriod(cfg Config) bool {
+	if cfg.GracePeriod <= 0 {
+		return false
+	}
+	age, err := startedAgo(cfg.StartFile)
+	if err != nil {
+		warn(fmt.Sprintf("ignoring -grace-period: %v", err))
+		return false
+	}
+	if age >= cfg.GracePeriod {
+		return false
+	}
+	warn(fmt.Sprintf("started %s ago, within the %s grace period; reporting healthy", age.Round(time.Second), cfg.GracePeriod))
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func newGRPCConn(cfg Config) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if cfg.GRPCTLS {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	dial, err := newDialFunc(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent(cfg.UserAgent),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}),
+	}
+	if cfg.Host != "" {
+		opts = append(opts, grpc.WithAuthority(cfg.Host))
+	}
+	target := cfg.GRPCAddr
+	if _, ok := cfg.Resolve[strings.ToLower(target)]; ok || cfg.SOCKS5 != "" {
+		// gRPC resolves DNS names itself unless the target is passed through
+		// to the dialer as is, which -resolve and -socks5 need.
+		target = "passthrough:///" + target
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc target: %w", err)
+	}
+	return conn, nil
+}
+
+// checkGRPC calls the standard grpc.health.v1.Health/Check method and treats
+// SERVING as healthy.
+func checkGRPC(ctx context.Context, conn *grpc.ClientConn, cfg Config, res *result) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: cfg.GRPCService})
+	res.Latency = time.Since(start)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.DeadlineExceeded:
+			return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+		case codes.Unavailable:
+			return fmt.Errorf("%w: %v", errConnection, err)
+		default:
+			return err
+		}
+	}
+	log.Printf("grpc %s service %q: %s in %s", cfg.GRPCAddr, cfg.GRPCService, resp.GetStatus(), res.Latency)
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%w %s", errUnexpectedStatus, resp.GetStatus())
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+func newClient(cfg Config) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer := newDialer(cfg)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if transport.DialContext, err = newDialFunc(cfg); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.NoProxy, cfg.SOCKS5 != "":
+		transport.Proxy = nil
+	case cfg.Proxy != "":
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	// Reusing connections hides handshake failures and latency after the
+	// first check, which matters with -retries, -wait and -daemon.
+	transport.DisableKeepAlives = cfg.NoKeepAlive
+	transport.DisableCompression = cfg.NoCompression
+	if cfg.HTTP1 {
+		// A non-nil, empty TLSNextProto disables the automatic h2 upgrade.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if cfg.UnixSocket != "" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+	}
+	return &http.Client{
+		Timeout:       cfg.Timeout,
+		Transport:     transport,
+		CheckRedirect: redirectPolicy(cfg),
+	}, nil
+}
+
+func redirectPolicy(cfg Config) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !cfg.Redirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > cfg.MaxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", errUnexpectedStatus, cfg.MaxRedirects)
+		}
+		log.Printf("following redirect to %s", req.URL.Redacted())
+		return nil
+	}
+}
+
+func check(ctx context.Context, client *http.Client, cfg Config, res *result) error {
+	var reqBody io.Reader
+	if cfg.Body != "" {
+		reqBody = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, res.Target, reqBody)
+	if err != nil {
+		return err
+	}
+	if cfg.Body != "" {
+		req.Header.Set("Content-Type", bodyContentType(cfg.Body))
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for name, values := range cfg.Headers {
+		req.Header[name] = values
+	}
+	if cfg.User != "" {
+		req.SetBasicAuth(cfg.User, cfg.Password)
+	}
+	if host := cfg.Headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+	if cfg.Host != "" {
+		req.Host = cfg.Host
+	}
+	if cfg.NoKeepAlive {
+		defer client.CloseIdleConnections()
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	res.Latency = time.Since(start)
+	if err != nil {
+		return err
+	}
+	defer drain(resp.Body, cfg.MaxResponseBytes)
+	res.StatusCode = resp.StatusCode
+	res.Status, res.Header = resp.Proto+" "+resp.Status, resp.Header
+	log.Printf("%s %s: %s %s in %s", cfg.Method, redactURL(res.Target), resp.Proto, resp.Status, res.Latency)
+	if cfg.ReachableOnly {
+		return nil
+	}
+	if !cfg.StatusCodes[resp.StatusCode] {
+		keepBody(resp, cfg, res)
+		return fmt.Errorf("%w %s", errUnexpectedStatus, resp.Status)
+	}
+	if err := matchHeaders(resp.Header, cfg.ExpectHeaders); err != nil {
+		keepBody(resp, cfg, res)
+		return err
+	}
+	if cfg.ExpectBody == "" && cfg.ExpectRegex == nil && cfg.JSONPath == "" && cfg.MaxLatency == 0 {
+		return nil
+	}
+	reader, err := decodeBody(resp, cfg)
+	if err != nil {
+		return err
+	}
+	// Read one byte past the limit to tell a body of exactly the limit from
+	// a longer one. The limit applies to the decompressed body.
+	body, err := io.ReadAll(io.LimitReader(reader, cfg.MaxResponseBytes+1))
+	res.Latency = time.Since(start)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if cfg.SaveBodyOnFail != "" {
+		res.Body = body[:min(int64(len(body)), cfg.MaxResponseBytes)]
+	}
+	if int64(len(body)) > cfg.MaxResponseBytes {
+		return fmt.Errorf("%w: body exceeds %d bytes", errTooLarge, cfg.MaxResponseBytes)
+	}
+	return matchBody(body, cfg)
+}
+
+// keepBody reads the body of a response that failed before it would have
+// been read for matching, so -save-body-on-fail has something to write.
+func keepBody(resp *http.Response, cfg Config, res *result) {
+	if cfg.SaveBodyOnFail == "" {
+		return
+	}
+	if reader, err := decodeBody(resp, cfg); err == nil {
+		res.Body, _ = io.ReadAll(io.LimitReader(reader, cfg.MaxResponseBytes))
+	}
+}
+
+// matchHeaders checks the -expect-header and -expect-header-regex
+// assertions. A header sent several times passes if any of its values match.
+func matchHeaders(header http.Header, checks []headerExpectation) error {
+	for _, check := range checks {
+		values := header.Values(check.Name)
+		if len(values) == 0 {
+			return fmt.Errorf("%w: missing %s", errHeaderMismatch, check.Name)
+		}
+		if check.Value == "" && check.Regex == nil {
+			continue
+		}
+		matched := slices.ContainsFunc(values, func(value string) bool {
+			if check.Regex != nil {
+				return check.Regex.MatchString(value)
+			}
+			return value == check.Value
+		})
+		if matched {
+			continue
+		}
+		if check.Regex != nil {
+			return fmt.Errorf("%w: %s is %q, does not match %q", errHeaderMismatch, check.Name, strings.Join(values, ", "), check.Regex)
+		}
+		return fmt.Errorf("%w: %s is %q, want %q", errHeaderMismatch, check.Name, strings.Join(values, ", "), check.Value)
+	}
+	return nil
+}
+
+// decodeBody returns the response body, gunzipped when the server
+// compressed it. The transport only does that itself for the Accept-Encoding
+// it adds, not for one given with -header, and never with -no-compression,
+// which matches the raw bytes.
+func decodeBody(resp *http.Response, cfg Config) (io.Reader, error) {
+	if resp.Uncompressed || cfg.NoCompression || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return gz, nil
+}
+
+// drain reads what is left of a response body, up to limit bytes, before
+// closing it so the connection can be reused for the next attempt. A longer
+// body is cut off and its connection closed instead.
+func drain(body io.ReadCloser, limit int64) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, limit))
+	body.Close()
+}
+
+func bodyContentType(body string) string {
+	if json.Valid([]byte(body)) {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func matchBody(body []byte, cfg Config) error {
+	if cfg.ExpectBody != "" && !strings.Contains(string(body), cfg.ExpectBody) {
+		return fmt.Errorf("%w: does not contain %q", errBodyMismatch, cfg.ExpectBody)
+	}
+	if cfg.ExpectRegex != nil && !cfg.ExpectRegex.Match(body) {
+		return fmt.Errorf("%w: does not match %q", errBodyMismatch, cfg.ExpectRegex)
+	}
+	if cfg.JSONPath != "" {
+		return matchJSON(body, cfg.JSONPath, cfg.JSONValue)
+	}
+	return nil
+}
+
+// matchJSON walks the dotted path through the JSON objects in body and, when
+// want is set, compares the field it finds with it. Strings are compared as
+// is, other values in their JSON encoding, so -json-value true or 3 match
+// booleans and numbers.
+func matchJSON(body []byte, path string, want *string) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%w: invalid JSON: %v", errBodyMismatch, err)
+	}
+	walked := ""
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: %s is not an object", errBodyMismatch, jsonLocation(walked))
+		}
+		if value, ok = object[key]; !ok {
+			return fmt.Errorf("%w: missing key %q in %s", errBodyMismatch, key, jsonLocation(walked))
+		}
+		walked = strings.TrimPrefix(walked+"."+key, ".")
+	}
+	if want == nil {
+		return nil
+	}
+	got, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", errBodyMismatch, path, err)
+		}
+		got = string(encoded)
+	}
+	if got != *want {
+		return fmt.Errorf("%w: %s is %q, want %q", errBodyMismatch, path, got, *want)
+	}
+	return nil
+}
+
+func jsonLocation(path string) string {
+	if path == "" {
+		return "response body"
+	}
+	return path
+}
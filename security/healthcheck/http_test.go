@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// proxyStub stands in for a forward proxy and reports the request target of
+// everything sent through it on proxied.
+var (
+	proxyStub *httptest.Server
+	proxied   = make(chan string, 8)
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	// net/http reads HTTP_PROXY once per process, so the stub is exported
+	// for the whole run. Loopback targets, which the other tests use, are
+	// never sent to it.
+	proxyStub = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.RequestURI
+	}))
+	os.Setenv("HTTP_PROXY", proxyStub.URL)
+	code := m.Run()
+	proxyStub.Close()
+	os.Exit(code)
+}
+
+// testConfig returns the configuration loadConfig builds for -url target
+// with every other flag at its default.
+func testConfig(target string) Config {
+	return Config{
+		URLs:             []string{target},
+		Method:           http.MethodGet,
+		Timeout:          5 * time.Second,
+		RetryInterval:    time.Second,
+		WaitTimeout:      defaultWait,
+		MaxRedirects:     maxRedirects,
+		StatusCodes:      map[int]bool{http.StatusOK: true},
+		MaxResponseBytes: defaultMaxBody,
+		UserAgent:        "openclaw-healthcheck/test",
+		Workers:          defaultWorkers,
+		Format:           "text",
+	}
+}
+
+// checkOnce runs a single HTTP check of target with cfg.
+func checkOnce(t *testing.T, cfg Config, target string) (result, error) {
+	t.Helper()
+	client, err := newClient(cfg)
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	defer client.CloseIdleConnections()
+	res := result{Target: target, Attempt: 1}
+	err = check(context.Background(), client, cfg, &res)
+	return res, err
+}
+
+func TestCheckHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		http1 bool
+		want  string
+	}{
+		{name: "default", want: "HTTP/2.0"},
+		{name: "http1", http1: true, want: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(server.URL)
+			cfg.Insecure = true
+			cfg.HTTP1 = tt.http1
+			res, err := checkOnce(t, cfg, server.URL)
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if got := res.Header.Get("X-Proto"); got != tt.want {
+				t.Errorf("server saw %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	// A name that does not resolve, so the request cannot succeed by going
+	// direct, and is not exempt from HTTP_PROXY the way loopback is.
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	target := "http://upstream.test:" + port + "/health"
+
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		proxied   bool
+	}{
+		{name: "proxy", configure: func(cfg *Config) { cfg.Proxy = proxyStub.URL }, proxied: true},
+		{name: "environment", configure: func(*Config) {}, proxied: true},
+		{
+			name: "no proxy",
+			configure: func(cfg *Config) {
+				cfg.NoProxy = true
+				cfg.Resolve = map[string]string{"upstream.test:" + port: upstream.Listener.Addr().String()}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(target)
+			tt.configure(&cfg)
+			if _, err := checkOnce(t, cfg, target); err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			select {
+			case got := <-proxied:
+				if !tt.proxied {
+					t.Errorf("request for %s went through the proxy", got)
+				} else if got != target {
+					t.Errorf("proxy got request for %q, want the absolute form %q", got, target)
+				}
+			default:
+				if tt.proxied {
+					t.Error("request did not go through the proxy")
+				}
+			}
+		})
+	}
+}
@@ -1,16 +1,283 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// Exit codes, documented in security/README.md.
+const (
+	exitHealthy      = 0
+	exitUnhealthy    = 1
+	exitConfigError  = 2
+	exitConnection   = 3
+	exitTimeout      = 4
+	exitBodyMismatch = 5
+	exitDegraded     = 6
+	exitTooLarge     = 7
+	exitDeadline     = 8
+	exitInterrupted  = 130
+)
+
+var (
+	errUnexpectedStatus = errors.New("unexpected status")
+	errBodyMismatch     = errors.New("body mismatch")
+	errHeaderMismatch   = errors.New("header mismatch")
+	errConnection       = errors.New("connection failed")
+	errDegraded         = errors.New("degraded")
+	errTooLarge         = errors.New("response too large")
+)
+
+// probeFunc performs a single check attempt, recording what it observed in res.
+type probeFunc func(ctx context.Context, res *result) error
+
+// result describes the outcome of a single check attempt.
+type result struct {
+	Target     string
+	StatusCode int
+	Latency    time.Duration
+	Attempt    int
+	Err        error
+
+	// Status and Header hold the HTTP response line and headers for
+	// -dump-headers, Body the response body for -save-body-on-fail.
+	Status string
+	Header http.Header
+	Body   []byte
+}
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// stderr receives diagnostics. Run writes its results to the writer it is
+// given, so both can be captured in tests.
+var stderr io.Writer = os.Stderr
+
 func main() {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8080/health")
-	if err != nil || resp.StatusCode != http.StatusOK {
-		os.Exit(1)
+	cfg, err := loadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.Usage()
+		os.Exit(exitHealthy)
+	}
+	if err != nil {
+		configError(err)
+	}
+	os.Exit(Run(cfg, os.Stdout))
+}
+
+// Run performs the checks described by cfg, writes any requested output
+// (-format, -print-config) to w and returns the process exit code. With
+// -daemon it keeps polling and serving /healthz until interrupted, with
+// -diagnose it reports each connection step instead.
+func Run(cfg Config, w io.Writer) int {
+	if cfg.ShowVersion {
+		fmt.Fprintln(w, "healthcheck", version)
+		return exitHealthy
+	}
+	if cfg.PrintConfig {
+		if err := printConfig(w, cfg); err != nil {
+			fmt.Fprintln(stderr, "healthcheck:", err)
+			return exitConfigError
+		}
+		return exitHealthy
+	}
+
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("healthcheck: ")
+	log.SetOutput(stderr)
+	if !cfg.Verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	probe, err := newProbe(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return exitConfigError
+	}
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Daemon {
+		return runDaemon(interrupted, cfg, probe)
+	}
+	ctx := interrupted
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+		defer cancel()
+	}
+	if cfg.Diagnose {
+		return runDiagnose(ctx, cfg, probe, w)
+	}
+	deadline := ctx
+	if cfg.Wait {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.WaitTimeout)
+		defer cancel()
+	}
+	results := checkAll(ctx, cfg, probe)
+	if err := newFormatter(cfg)(w, results); err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+	}
+	if cfg.MetricsFile != "" {
+		if err := writeMetrics(cfg.MetricsFile, results); err != nil {
+			warn(err.Error())
+		}
+	}
+	if cfg.SaveBodyOnFail != "" {
+		saveFailedBodies(cfg.SaveBodyOnFail, results)
 	}
-	resp.Body.Close()
+	err = overall(cfg, results)
+	if err == nil {
+		return exitHealthy
+	}
+	if interrupted.Err() != nil {
+		fmt.Fprintln(stderr, "healthcheck: interrupted")
+		return exitInterrupted
+	}
+	code := exitCode(err)
+	if cfg.Deadline > 0 && deadline.Err() != nil {
+		attempts := 0
+		for _, res := range results {
+			attempts += res.Attempt
+		}
+		fmt.Fprintf(stderr, "healthcheck: deadline of %s exceeded after %d attempt(s)\n", cfg.Deadline, attempts)
+		code = exitDeadline
+	}
+	if inGracePeriod(cfg) {
+		return exitHealthy
+	}
+	return code
+}
+
+// checkAll checks every target concurrently with at most cfg.Workers checks
+// in flight and returns the results in target order.
+func checkAll(ctx context.Context, cfg Config, probe probeFunc) []result {
+	targets := cfg.targets()
+	results := make([]result, len(targets))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(cfg.Workers, len(targets)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = checkTarget(ctx, cfg, probe, targets[index])
+			}
+		}()
+	}
+	for index := range targets {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// checkTarget runs up to cfg.Retries+1 attempts against target, or with
+// cfg.Wait keeps attempting until one passes or ctx is done.
+func checkTarget(ctx context.Context, cfg Config, probe probeFunc, target string) result {
+	name := redactURL(target)
+	log.Printf("target %s (timeout %s, retries %d, wait %t)", name, cfg.Timeout, cfg.Retries, cfg.Wait)
+	var res result
+	for attempt := 1; ; attempt++ {
+		log.Printf("%s: attempt %d", name, attempt)
+		res = result{Target: target, Attempt: attempt}
+		if res.Err = probe(ctx, &res); res.Err == nil {
+			res.Err = checkLatency(cfg, res)
+		}
+		if res.Err == nil {
+			break
+		}
+		log.Printf("%s: attempt %d failed after %s: %v", name, attempt, res.Latency, res.Err)
+		if !cfg.Wait && attempt > cfg.Retries {
+			break
+		}
+		if cfg.Wait {
+			fmt.Fprintf(stderr, "healthcheck: waiting for %s (attempt %d): %v\n", name, attempt, res.Err)
+		}
+		if !sleep(ctx, cfg.RetryInterval) {
+			res.Err = fmt.Errorf("gave up after %d attempt(s): %w", attempt, res.Err)
+			break
+		}
+	}
+	if res.Err == nil {
+		log.Printf("%s: healthy after %d attempt(s), latency %s", name, res.Attempt, res.Latency)
+	} else {
+		log.Printf("%s: unhealthy after %d attempt(s)", name, res.Attempt)
+	}
+	return res
+}
+
+// sleep waits for d and reports false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// overall returns nil when the run as a whole is healthy: every target
+// passed, or with -any at least one did. Otherwise it returns the first
+// failure in target order.
+func overall(cfg Config, results []result) error {
+	var firstErr error
+	for _, res := range results {
+		if res.Err == nil && cfg.Any {
+			return nil
+		}
+		if res.Err != nil && firstErr == nil {
+			firstErr = res.Err
+		}
+	}
+	return firstErr
+}
+
+// exitCode classifies a failed check so monitoring can tell a down service
+// from a slow or misbehaving one.
+func exitCode(err error) int {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitHealthy
+	case errors.Is(err, errBodyMismatch), errors.Is(err, errHeaderMismatch):
+		return exitBodyMismatch
+	case errors.Is(err, errTooLarge):
+		return exitTooLarge
+	case errors.Is(err, errDegraded):
+		return exitDegraded
+	case errors.Is(err, errUnexpectedStatus):
+		return exitUnhealthy
+	case errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err), errors.As(err, &netErr) && netErr.Timeout():
+		return exitTimeout
+	case errors.Is(err, errConnection), errors.As(err, &netErr):
+		return exitConnection
+	default:
+		return exitUnhealthy
+	}
+}
+
+func warn(msg string) {
+	fmt.Fprintln(stderr, "healthcheck: warning:", msg)
+}
+
+func configError(err error) {
+	fmt.Fprintln(stderr, "healthcheck:", err)
+	os.Exit(exitConfigError)
 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Version", "2.1.0")
+		io.WriteString(w, `{"status":"ok","checks":{"db":true}}`)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	// /gzip always compresses, whatever Accept-Encoding says, and its
+	// padding makes the body much bigger than on the wire.
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, `{"status":"ok","padding":"`+strings.Repeat("a", 4096)+`"}`)
+		gz.Close()
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	server := newTestServer(t)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	saved := stderr
+	stderr = io.Discard
+	t.Cleanup(func() { stderr = saved })
+
+	ok, down := "ok", "down"
+	tests := []struct {
+		name      string
+		target    string
+		configure func(*Config)
+		want      int
+		wantOut   string
+	}{
+		{name: "healthy", target: server.URL + "/health", want: exitHealthy},
+		{name: "unexpected status", target: server.URL + "/error", want: exitUnhealthy},
+		{
+			name:      "accepted status",
+			target:    server.URL + "/error",
+			configure: func(cfg *Config) { cfg.StatusCodes = map[int]bool{http.StatusInternalServerError: true} },
+			want:      exitHealthy,
+		},
+		{name: "connection refused", target: closed.URL, want: exitConnection},
+		{
+			name:      "timeout",
+			target:    server.URL + "/slow",
+			configure: func(cfg *Config) { cfg.Timeout = 50 * time.Millisecond },
+			want:      exitTimeout,
+		},
+		{
+			name:      "deadline",
+			target:    server.URL + "/slow",
+			configure: func(cfg *Config) { cfg.Deadline = 50 * time.Millisecond },
+			want:      exitDeadline,
+		},
+		{
+			name:      "degraded",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.MaxLatency = time.Nanosecond },
+			want:      exitDegraded,
+		},
+		{
+			name:      "body contains",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectBody = `"status":"ok"` },
+			want:      exitHealthy,
+		},
+		{
+			name:      "body mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectBody = "healthy" },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "body regex mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectRegex = regexp.MustCompile(`"status":"(up|green)"`) },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "json path",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.JSONPath, cfg.JSONValue = "status", &ok },
+			want:      exitHealthy,
+		},
+		{
+			name:      "json path value mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.JSONPath, cfg.JSONValue = "status", &down },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "json path non-string value",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.JSONPath = "checks.db"; value := "true"; cfg.JSONValue = &value },
+			want:      exitHealthy,
+		},
+		{
+			name:      "json path missing key",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.JSONPath = "checks.cache" },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:   "header match",
+			target: server.URL + "/health",
+			configure: func(cfg *Config) {
+				cfg.ExpectHeaders = []headerExpectation{{Name: "X-Version", Regex: regexp.MustCompile(`^2\.`)}}
+			},
+			want: exitHealthy,
+		},
+		{
+			name:      "header mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectHeaders = []headerExpectation{{Name: "X-Version", Value: "3.0.0"}} },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "header missing",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectHeaders = []headerExpectation{{Name: "X-Missing"}} },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "too large",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectBody, cfg.MaxResponseBytes = "ok", 8 },
+			want:      exitTooLarge,
+		},
+		{
+			name:      "gzip",
+			target:    server.URL + "/gzip",
+			configure: func(cfg *Config) { cfg.ExpectBody = `"status":"ok"` },
+			want:      exitHealthy,
+		},
+		{
+			name:   "gzip with Accept-Encoding header",
+			target: server.URL + "/gzip",
+			configure: func(cfg *Config) {
+				cfg.Headers = http.Header{"Accept-Encoding": {"gzip"}}
+				cfg.ExpectBody = `"status":"ok"`
+			},
+			want: exitHealthy,
+		},
+		{
+			name:      "gzip without compression",
+			target:    server.URL + "/gzip",
+			configure: func(cfg *Config) { cfg.NoCompression, cfg.ExpectBody = true, `"status":"ok"` },
+			want:      exitBodyMismatch,
+		},
+		{
+			name:      "gzip too large decompressed",
+			target:    server.URL + "/gzip",
+			configure: func(cfg *Config) { cfg.ExpectBody, cfg.MaxResponseBytes = `"status":"ok"`, 1024 },
+			want:      exitTooLarge,
+		},
+		{
+			name:   "gzip raw size without compression",
+			target: server.URL + "/gzip",
+			configure: func(cfg *Config) {
+				cfg.NoCompression, cfg.MaxResponseBytes = true, 1024
+				cfg.ExpectRegex = regexp.MustCompile(`(?s).`)
+			},
+			want: exitHealthy,
+		},
+		{
+			name:      "reachable only",
+			target:    server.URL + "/error",
+			configure: func(cfg *Config) { cfg.ReachableOnly = true },
+			want:      exitHealthy,
+		},
+		{
+			name:      "json output",
+			target:    server.URL + "/error",
+			configure: func(cfg *Config) { cfg.Format = "json" },
+			want:      exitUnhealthy,
+			wantOut:   `"status_code":500,`,
+		},
+		{
+			name:      "logfmt output",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.Format = "logfmt" },
+			want:      exitHealthy,
+			wantOut:   "status=200 ",
+		},
+		{
+			name:   "any",
+			target: closed.URL,
+			configure: func(cfg *Config) {
+				cfg.URLs = append(cfg.URLs, server.URL+"/health")
+				cfg.Any = true
+			},
+			want: exitHealthy,
+		},
+		{
+			name:      "first failure decides",
+			target:    server.URL + "/error",
+			configure: func(cfg *Config) { cfg.URLs = append(cfg.URLs, closed.URL) },
+			want:      exitUnhealthy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(tt.target)
+			if tt.configure != nil {
+				tt.configure(&cfg)
+			}
+			var out bytes.Buffer
+			if got := Run(cfg, &out); got != tt.want {
+				t.Errorf("Run = %d, want %d", got, tt.want)
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestRunSaveBodyOnFail(t *testing.T) {
+	server := newTestServer(t)
+	saved := stderr
+	stderr = io.Discard
+	t.Cleanup(func() { stderr = saved })
+
+	tests := []struct {
+		name      string
+		target    string
+		configure func(*Config)
+		want      string
+	}{
+		{name: "unexpected status", target: server.URL + "/error", want: "broken\n"},
+		{
+			name:      "header mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectHeaders = []headerExpectation{{Name: "X-Version", Value: "3.0.0"}} },
+			want:      `{"status":"ok","checks":{"db":true}}`,
+		},
+		{
+			name:      "body mismatch",
+			target:    server.URL + "/health",
+			configure: func(cfg *Config) { cfg.ExpectBody = "healthy" },
+			want:      `{"status":"ok","checks":{"db":true}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := testConfig(tt.target)
+			cfg.SaveBodyOnFail = filepath.Join(dir, "body.txt")
+			if tt.configure != nil {
+				tt.configure(&cfg)
+			}
+			if got := Run(cfg, io.Discard); got == exitHealthy {
+				t.Fatal("Run passed, want a failure")
+			}
+			files, err := filepath.Glob(filepath.Join(dir, "body-*.txt"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("saved files = %v, %v; want one", files, err)
+			}
+			body, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("saved body %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
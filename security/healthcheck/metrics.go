@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// writeMetrics writes the results in the Prometheus text exposition format
+// for node_exporter's textfile collector. The file is written to a temporary
+// name in the same directory and renamed so the collector never reads a
+// partial file.
+func writeMetrics(path string, results []result) error {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# HELP healthcheck_up Whether the last check of the target passed.")
+	fmt.Fprintln(&buf, "# TYPE healthcheck_up gauge")
+	for _, res := range results {
+		up := 0
+		if res.Err == nil {
+			up = 1
+		}
+		fmt.Fprintf(&buf, "healthcheck_up{url=\"%s\"} %d\n", escapeLabel(redactURL(res.Target)), up)
+	}
+	fmt.Fprintln(&buf, "# HELP healthcheck_duration_seconds Duration of the last check attempt.")
+	fmt.Fprintln(&buf, "# TYPE healthcheck_duration_seconds gauge")
+	for _, res := range results {
+		fmt.Fprintf(&buf, "healthcheck_duration_seconds{url=\"%s\"} %g\n", escapeLabel(redactURL(res.Target)), res.Latency.Seconds())
+	}
+	fmt.Fprintln(&buf, "# HELP healthcheck_attempts Number of attempts made in the last run.")
+	fmt.Fprintln(&buf, "# TYPE healthcheck_attempts gauge")
+	for _, res := range results {
+		fmt.Fprintf(&buf, "healthcheck_attempts{url=\"%s\"} %d\n", escapeLabel(redactURL(res.Target)), res.Attempt)
+	}
+	fmt.Fprintln(&buf, "# HELP healthcheck_last_run_timestamp_seconds Unix time of the last run.")
+	fmt.Fprintln(&buf, "# TYPE healthcheck_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(&buf, "healthcheck_last_run_timestamp_seconds %d\n", time.Now().Unix())
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
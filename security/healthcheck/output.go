@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// formatFunc renders the results of a run.
+type formatFunc func(w io.Writer, results []result) error
+
+// formats lists the values -format accepts.
+var formats = map[string]bool{"text": true, "json": true, "logfmt": true}
+
+// newFormatter returns the output for cfg.Format. The text format stays
+// silent unless the run failed and then prints the errors to stderr; the
+// others always write every result to w.
+func newFormatter(cfg Config) formatFunc {
+	switch cfg.Format {
+	case "json":
+		return withHeaderDump(cfg, writeJSON)
+	case "logfmt":
+		return withHeaderDump(cfg, writeLogfmt)
+	default:
+		return func(_ io.Writer, results []result) error {
+			if overall(cfg, results) != nil {
+				printFailures(cfg, results)
+			}
+			return nil
+		}
+	}
+}
+
+// withHeaderDump adds -dump-headers to a format that writes the results to
+// w. The headers go to stderr, as they do after the errors of the text
+// format.
+func withHeaderDump(cfg Config, format formatFunc) formatFunc {
+	if !cfg.DumpHeaders {
+		return format
+	}
+	return func(w io.Writer, results []result) error {
+		err := format(w, results)
+		for _, res := range results {
+			if res.Err != nil && res.Header != nil {
+				fmt.Fprintf(stderr, "healthcheck: %s:\n", redactURL(res.Target))
+				dumpHeaders(res, cfg.Verbose)
+			}
+		}
+		return err
+	}
+}
+
+func printFailures(cfg Config, results []result) {
+	for _, res := range results {
+		switch {
+		case res.Err == nil:
+			continue
+		case len(results) == 1:
+			fmt.Fprintln(stderr, "healthcheck:", res.Err)
+		default:
+			fmt.Fprintf(stderr, "healthcheck: %s: %v\n", redactURL(res.Target), res.Err)
+		}
+		if cfg.DumpHeaders && res.Header != nil {
+			dumpHeaders(res, cfg.Verbose)
+		}
+	}
+}
+
+// challengeHeaders explain a 401 or 407 and carry no credentials, so
+// dumpHeaders shows them although their names look sensitive.
+var challengeHeaders = []string{"Www-Authenticate", "Proxy-Authenticate"}
+
+// dumpHeaders prints the response line and headers of a failed check,
+// redacting credential-looking headers unless verbose is set.
+func dumpHeaders(res result, verbose bool) {
+	headers := res.Header
+	if !verbose {
+		headers = redactHeaders(headers)
+		for _, name := range challengeHeaders {
+			if values, ok := res.Header[name]; ok {
+				headers[name] = values
+			}
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(stderr, "  %s\n", res.Status)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(stderr, "  %s: %s\n", name, value)
+		}
+	}
+}
+
+type jsonResult struct {
+	URL        string  `json:"url"`
+	StatusCode int     `json:"status_code,omitempty"`
+	LatencyMS  float64 `json:"latency_ms"`
+	Attempt    int     `json:"attempt"`
+	Healthy    bool    `json:"healthy"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// writeJSON prints a single object for one target and an array otherwise.
+func writeJSON(w io.Writer, results []result) error {
+	out := make([]jsonResult, 0, len(results))
+	for _, res := range results {
+		entry := jsonResult{
+			URL:        redactURL(res.Target),
+			StatusCode: res.StatusCode,
+			LatencyMS:  float64(res.Latency.Microseconds()) / 1000,
+			Attempt:    res.Attempt,
+			Healthy:    res.Err == nil,
+		}
+		if res.Err != nil {
+			entry.Error = res.Err.Error()
+		}
+		out = append(out, entry)
+	}
+	if len(out) == 1 {
+		return json.NewEncoder(w).Encode(out[0])
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// writeLogfmt prints one line of key=value pairs per target, e.g.
+//
+//	url=http://localhost:8080/health status=200 latency_ms=12.3 attempt=1 healthy=true
+func writeLogfmt(w io.Writer, results []result) error {
+	for _, res := range results {
+		line := []string{"url=" + logfmtValue(redactURL(res.Target))}
+		if res.StatusCode != 0 {
+			line = append(line, "status="+strconv.Itoa(res.StatusCode))
+		}
+		line = append(line,
+			"latency_ms="+strconv.FormatFloat(float64(res.Latency.Microseconds())/1000, 'f', -1, 64),
+			"attempt="+strconv.Itoa(res.Attempt),
+			"healthy="+strconv.FormatBool(res.Err == nil),
+		)
+		if res.Err != nil {
+			line = append(line, "error="+logfmtValue(res.Err.Error()))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(line, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logfmtValue quotes values that would otherwise break the key=value split.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.ContainsFunc(s, unicode.IsControl) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// saveFailedBodies writes the response body of every failed result to a
+// file named after path with the time, and the target index when there are
+// several, inserted before the extension: fail.html becomes
+// fail-20240102-150405.000.html. Failures to write are only warned about.
+func saveFailedBodies(path string, results []result) {
+	stamp := time.Now().UTC().Format("20060102-150405.000")
+	ext := filepath.Ext(path)
+	for i, res := range results {
+		if res.Err == nil || res.Body == nil {
+			continue
+		}
+		name := strings.TrimSuffix(path, ext) + "-" + stamp
+		if len(results) > 1 {
+			name += "-" + strconv.Itoa(i+1)
+		}
+		name += ext
+		// Error pages can echo request details, so keep them private.
+		if err := os.WriteFile(name, res.Body, 0o600); err != nil {
+			warn(fmt.Sprintf("save body: %v", err))
+			continue
+		}
+		fmt.Fprintf(stderr, "healthcheck: saved response body of %s to %s\n", redactURL(res.Target), name)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDumpHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	saved := stderr
+	stderr = &buf
+	t.Cleanup(func() { stderr = saved })
+
+	dumpHeaders(result{
+		Status: "HTTP/1.1 401 Unauthorized",
+		Header: http.Header{
+			"Www-Authenticate": {`Bearer realm="api"`},
+			"Set-Cookie":       {"session=1"},
+			"X-Auth-Token":     {"s3cr3t"},
+		},
+	}, false)
+	for _, want := range []string{
+		"  HTTP/1.1 401 Unauthorized\n",
+		"  Www-Authenticate: Bearer realm=\"api\"\n",
+		"  Set-Cookie: REDACTED\n",
+		"  X-Auth-Token: REDACTED\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output %q does not contain %q", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// errPingPermission explains how to get a usable ICMP socket.
+var errPingPermission = errors.New("-ping needs a raw socket (CAP_NET_RAW) or an unprivileged ping socket allowed by net.ipv4.ping_group_range; use -tcp to check a port instead")
+
+// pingPayload identifies our echo requests in packet captures.
+var pingPayload = []byte("openclaw-healthcheck")
+
+// listenICMP opens a raw ICMP socket, falling back to the unprivileged
+// datagram ping socket Linux offers. The returned network tells which one
+// was opened, since the two expect different destination address types.
+func listenICMP(ipv6Target bool, localAddr *net.TCPAddr) (*icmp.PacketConn, string, error) {
+	raw, datagram, addr := "ip4:icmp", "udp4", "0.0.0.0"
+	if ipv6Target {
+		raw, datagram, addr = "ip6:ipv6-icmp", "udp6", "::"
+	}
+	if localAddr != nil {
+		addr = localAddr.IP.String()
+	}
+	conn, err := icmp.ListenPacket(raw, addr)
+	if err == nil {
+		return conn, raw, nil
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		return nil, "", err
+	}
+	conn, err = icmp.ListenPacket(datagram, addr)
+	if errors.Is(err, os.ErrPermission) {
+		return nil, "", errPingPermission
+	}
+	return conn, datagram, err
+}
+
+// checkPingPermission fails early, as a configuration error, when no ICMP
+// socket can be opened at all.
+func checkPingPermission(cfg Config) error {
+	conn, _, err := listenICMP(false, cfg.LocalAddr)
+	if errors.Is(err, errPingPermission) {
+		return err
+	}
+	if err == nil {
+		conn.Close()
+	}
+	return nil
+}
+
+// checkPing sends one ICMP echo request to cfg.Ping and waits up to
+// cfg.Timeout for the matching reply.
+func checkPing(ctx context.Context, cfg Config, res *result) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, cfg.Ping)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConnection, err)
+	}
+	target := ips[0].IP
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			target = ip.IP
+			break
+		}
+	}
+	ipv6Target := target.To4() == nil
+	conn, network, err := listenICMP(ipv6Target, cfg.LocalAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := 1
+	if ipv6Target {
+		echoType, replyType, protocol = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+	request, err := (&icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: res.Attempt, Data: pingPayload},
+	}).Marshal(nil)
+	if err != nil {
+		return err
+	}
+	var dst net.Addr = &net.IPAddr{IP: target}
+	if network == "udp4" || network == "udp6" {
+		dst = &net.UDPAddr{IP: target}
+	}
+	if _, err := conn.WriteTo(request, dst); err != nil {
+		return fmt.Errorf("%w: %v", errConnection, err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		res.Latency = time.Since(start)
+		if ctx.Err() != nil {
+			return fmt.Errorf("no echo reply from %s: %w", target, ctx.Err())
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errConnection, err)
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		// A raw socket sees every ICMP packet and ping sockets rewrite the
+		// ID, so match on the sequence number and the sender.
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != res.Attempt || !sameIP(peer, target) {
+			continue
+		}
+		log.Printf("echo reply from %s in %s", target, res.Latency)
+		return nil
+	}
+}
+
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	default:
+		return false
+	}
+}
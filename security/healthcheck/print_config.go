@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// MarshalJSON renders durations, status codes and addresses in the form the
+// flags accept and redacts credentials and the request body for
+// -print-config.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	out := struct {
+		plain
+		URLs           []string    `json:"urls"`
+		Body           string      `json:"body,omitempty"`
+		Timeout        string      `json:"timeout"`
+		MaxLatency     string      `json:"max_latency"`
+		RetryInterval  string      `json:"retry_interval"`
+		WaitTimeout    string      `json:"wait_timeout"`
+		Deadline       string      `json:"deadline"`
+		GracePeriod    string      `json:"grace_period"`
+		Interval       string      `json:"interval"`
+		Jitter         string      `json:"jitter"`
+		LocalAddr      string      `json:"local_addr,omitempty"`
+		Proxy          string      `json:"proxy,omitempty"`
+		TLSMinVersion  string      `json:"tls_min_version"`
+		TLSMaxVersion  string      `json:"tls_max_version,omitempty"`
+		StatusCodes    []int       `json:"status"`
+		Headers        http.Header `json:"headers"`
+		Password       string      `json:"password,omitempty"`
+		SOCKS5Password string      `json:"socks5_password,omitempty"`
+	}{
+		plain:         plain(c),
+		URLs:          make([]string, 0, len(c.URLs)),
+		Proxy:         redactURL(c.Proxy),
+		Timeout:       c.Timeout.String(),
+		MaxLatency:    c.MaxLatency.String(),
+		RetryInterval: c.RetryInterval.String(),
+		WaitTimeout:   c.WaitTimeout.String(),
+		Deadline:      c.Deadline.String(),
+		GracePeriod:   c.GracePeriod.String(),
+		Interval:      c.Interval.String(),
+		Jitter:        c.Jitter.String(),
+		TLSMinVersion: tlsVersionString(c.TLSMinVersion),
+		TLSMaxVersion: tlsVersionString(c.TLSMaxVersion),
+		StatusCodes:   make([]int, 0, len(c.StatusCodes)),
+		Headers:       redactHeaders(c.Headers),
+	}
+	for _, target := range c.URLs {
+		out.URLs = append(out.URLs, redactURL(target))
+	}
+	if c.Body != "" {
+		out.Body = redacted
+	}
+	if c.LocalAddr != nil {
+		out.LocalAddr = c.LocalAddr.String()
+	}
+	for code := range c.StatusCodes {
+		out.StatusCodes = append(out.StatusCodes, code)
+	}
+	sort.Ints(out.StatusCodes)
+	if c.Password != "" {
+		out.Password = redacted
+	}
+	if c.SOCKS5Password != "" {
+		out.SOCKS5Password = redacted
+	}
+	return json.Marshal(out)
+}
+
+// redactURL masks the password of a URL with credentials so targets can be
+// printed, logged and exported. Anything that does not parse as a URL is
+// returned as is.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+func printConfig(w io.Writer, cfg Config) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
+
+func redactHeaders(headers http.Header) http.Header {
+	out := make(http.Header, len(headers))
+	for name, values := range headers {
+		if !isSensitiveHeader(name) {
+			out[name] = values
+			continue
+		}
+		masked := make([]string, len(values))
+		for i := range values {
+			masked[i] = redacted
+		}
+		out[name] = masked
+	}
+	return out
+}
+
+// isSensitiveHeader reports whether a header is likely to carry credentials.
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	for _, word := range []string{"token", "secret", "key", "password", "auth", "session"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
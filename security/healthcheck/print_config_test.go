@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization":    {"Bearer abc"},
+		"Cookie":           {"session=1"},
+		"X-Service-Token":  {"s3cr3t"},
+		"Private-Token":    {"abc"},
+		"X-Shared-Secret":  {"xyz"},
+		"X-Api-Key":        {"k1", "k2"},
+		"Www-Authenticate": {`Bearer realm="api"`},
+		"Content-Type":     {"application/json"},
+		"X-Request-Id":     {"42"},
+	}
+	got := redactHeaders(headers)
+	for name, values := range headers {
+		want := values
+		if name != "Content-Type" && name != "X-Request-Id" {
+			want = make([]string, len(values))
+			for i := range want {
+				want[i] = redacted
+			}
+		}
+		if len(got[name]) != len(want) {
+			t.Errorf("%s = %q, want %q", name, got[name], want)
+			continue
+		}
+		for i := range want {
+			if got[name][i] != want[i] {
+				t.Errorf("%s = %q, want %q", name, got[name], want)
+				break
+			}
+		}
+	}
+	if headers.Get("Authorization") != "Bearer abc" {
+		t.Error("redactHeaders modified its argument")
+	}
+}
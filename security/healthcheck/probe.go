@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// newProbe returns the check for the configured mode: TCP, gRPC, ICMP or
+// HTTP.
+func newProbe(cfg Config) (probeFunc, error) {
+	if cfg.Ping != "" {
+		if err := checkPingPermission(cfg); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, res *result) error { return checkPing(ctx, cfg, res) }, nil
+	}
+	if cfg.TCPAddr != "" {
+		dial, err := newDialFunc(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, res *result) error { return checkTCP(ctx, dial, cfg, res) }, nil
+	}
+	if cfg.GRPCAddr != "" {
+		conn, err := newGRPCConn(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, res *result) error { return checkGRPC(ctx, conn, cfg, res) }, nil
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, res *result) error { return check(ctx, client, cfg, res) }, nil
+}
+
+func newDialer(cfg Config) *net.Dialer {
+	dialer := &net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second}
+	if cfg.LocalAddr != nil {
+		dialer.LocalAddr = cfg.LocalAddr
+	}
+	return dialer
+}
+
+// dialFunc opens a connection like net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialFunc dials like newDialer, through the -socks5 proxy when one is
+// set, and connects to the -resolve override for addresses that have one,
+// bypassing DNS.
+func newDialFunc(cfg Config) (dialFunc, error) {
+	dialer := newDialer(cfg)
+	dial := dialer.DialContext
+	if cfg.SOCKS5 != "" {
+		var auth *proxy.Auth
+		if cfg.SOCKS5User != "" || cfg.SOCKS5Password != "" {
+			auth = &proxy.Auth{User: cfg.SOCKS5User, Password: cfg.SOCKS5Password}
+		}
+		socks, err := proxy.SOCKS5("tcp", cfg.SOCKS5, auth, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("socks5: %w", err)
+		}
+		dial = socks.(proxy.ContextDialer).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if override, ok := cfg.Resolve[strings.ToLower(addr)]; ok {
+			log.Printf("resolve %s to %s", addr, override)
+			addr = override
+		}
+		return dial(ctx, network, addr)
+	}, nil
+}
+
+// checkLatency turns a passing check that was slower than -max-latency into
+// a degraded one.
+func checkLatency(cfg Config, res result) error {
+	if cfg.MaxLatency > 0 && res.Latency > cfg.MaxLatency {
+		return fmt.Errorf("%w: took %s, more than %s", errDegraded, res.Latency, cfg.MaxLatency)
+	}
+	return nil
+}
+
+func checkTCP(ctx context.Context, dial dialFunc, cfg Config, res *result) error {
+	start := time.Now()
+	conn, err := dial(ctx, "tcp", cfg.TCPAddr)
+	res.Latency = time.Since(start)
+	if err != nil {
+		return err
+	}
+	log.Printf("connected to %s in %s", conn.RemoteAddr(), res.Latency)
+	return conn.Close()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: serverName(cfg.Host),
+		MinVersion: cfg.TLSMinVersion,
+		MaxVersion: cfg.TLSMaxVersion,
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.Insecure {
+		if cfg.CACert != "" {
+			warn("-insecure is set, ignoring -ca-cert")
+		}
+		tlsConfig.InsecureSkipVerify = true
+		return tlsConfig, nil
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read ca cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca cert %s: no PEM certificates found", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// tlsVersions lists the versions -tls-min-version and -tls-max-version
+// accept. TLS 1.0 and 1.1 are left out so a check can never negotiate what
+// security scans flag.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(raw string) (uint16, error) {
+	version, ok := tlsVersions[raw]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version %q: must be 1.2 or 1.3", raw)
+	}
+	return version, nil
+}
+
+// tlsVersionString is the inverse of parseTLSVersion.
+func tlsVersionString(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return ""
+}
+
+// serverName returns the SNI and verification name for a -host override,
+// which may carry a port for the Host header.
+func serverName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return host
+}
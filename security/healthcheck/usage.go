@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// flagGroups orders the options in the usage message. Flags missing from
+// every group are listed under "Other" so a new flag is never hidden.
+var flagGroups = []struct {
+	title string
+	names []string
+}{
+	{"Targets", []string{"url", "tcp", "grpc", "ping", "grpc-service", "grpc-tls", "unix", "any", "workers"}},
+	{"Request", []string{"method", "body", "body-file", "header", "host", "user", "password", "password-file", "user-agent", "follow-redirects", "max-redirects"}},
+	{"Connection", []string{"timeout", "local-addr", "resolve", "proxy", "no-proxy", "socks5", "socks5-user", "socks5-password", "http1", "no-keepalive", "no-compression"}},
+	{"TLS", []string{"insecure", "ca-cert", "client-cert", "client-key", "tls-min-version", "tls-max-version"}},
+	{"Matching", []string{"status", "reachable-only", "expect-body", "expect-regex", "json-path", "json-value", "expect-header", "expect-header-regex", "max-response-bytes", "max-latency"}},
+	{"Retries", []string{"retries", "retry-interval", "wait", "wait-timeout", "deadline", "grace-period", "start-file"}},
+	{"Daemon", []string{"daemon", "listen", "interval", "jitter", "interval-immediate"}},
+	{"Output", []string{"format", "json", "dump-headers", "save-body-on-fail", "metrics-file", "v", "print-config"}},
+	{"General", []string{"config", "no-expand", "diagnose", "version", "h", "help"}},
+}
+
+const usageExamples = `Examples:
+  # Default check of http://localhost:8080/health
+  HEALTHCHECK CMD ["/usr/local/bin/healthcheck"]
+
+  # Readiness endpoint with a JSON status field and a tighter timeout
+  HEALTHCHECK CMD ["/usr/local/bin/healthcheck", "-url", "http://localhost:8080/ready", "-json-path", "status", "-json-value", "ok", "-timeout", "3s"]
+
+  # Port check for a database and a gRPC health check
+  HEALTHCHECK CMD ["/usr/local/bin/healthcheck", "-tcp", "localhost:5432"]
+  HEALTHCHECK CMD ["/usr/local/bin/healthcheck", "-grpc", "localhost:50051", "-grpc-service", "api"]
+
+  # Lenient liveness probe that only requires an answer
+  HEALTHCHECK CMD ["/usr/local/bin/healthcheck", "-reachable-only"]
+
+Exit codes: 0 healthy, 1 unhealthy, 2 config error, 3 connection, 4 timeout,
+5 response mismatch, 6 degraded, 7 response too large, 8 deadline exceeded,
+130 interrupted.
+`
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: healthcheck [options]\n\nChecks an HTTP, TCP, gRPC or ICMP (ping) endpoint and reports the result in the exit code.\nSingle-letter flags can be combined: -vh is -v -h.\n")
+	listed := map[string]bool{}
+	for _, group := range flagGroups {
+		fmt.Fprintf(out, "\n%s:\n", group.title)
+		for _, name := range group.names {
+			if f := flag.Lookup(name); f != nil {
+				printFlag(f)
+				listed[name] = true
+			}
+		}
+	}
+	var other []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !listed[f.Name] {
+			other = append(other, f)
+		}
+	})
+	if len(other) > 0 {
+		fmt.Fprintf(out, "\nOther:\n")
+		for _, f := range other {
+			printFlag(f)
+		}
+	}
+	fmt.Fprintf(out, "\n%s", usageExamples)
+}
+
+// printFlag formats f like flag.PrintDefaults does.
+func printFlag(f *flag.Flag) {
+	name, text := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	line += "\n    \t" + strings.ReplaceAll(text, "\n", "\n    \t")
+	switch {
+	case f.DefValue == "", f.DefValue == "false", f.DefValue == "0", f.DefValue == "0s":
+	case name == "string":
+		line += fmt.Sprintf(" (default %q)", f.DefValue)
+	default:
+		line += fmt.Sprintf(" (default %s)", f.DefValue)
+	}
+	fmt.Fprintln(flag.CommandLine.Output(), line)
+}